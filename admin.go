@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// handleAdminRooms reports the routing mode and client count of every active
+// room, for operators to inspect without grepping logs.
+func (r *RoomRegistry) handleAdminRooms(w http.ResponseWriter, req *http.Request) {
+	hubs := r.snapshotHubs()
+
+	infos := make([]RoomInfo, 0, len(hubs))
+	for _, h := range hubs {
+		reply := make(chan RoomInfo, 1)
+		h.info <- reply
+		infos = append(infos, <-reply)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
@@ -0,0 +1,19 @@
+package main
+
+// Backplane lets multiple gostream processes behind a load balancer serve
+// the same room. When a RoomRegistry is configured with one, a Hub forwards
+// every locally-published message to it and fans messages published by
+// other instances back into its own broadcast, so clients connected to
+// different processes still see each other.
+type Backplane interface {
+	// Publish sends msg to every other instance subscribed to room.
+	Publish(room string, msg []byte) error
+
+	// Subscribe starts receiving messages published to room by other
+	// instances. The returned channel is closed if the subscription ends.
+	Subscribe(room string) (<-chan []byte, error)
+
+	// Unsubscribe stops receiving messages for room and releases any
+	// resources Subscribe allocated for it.
+	Unsubscribe(room string)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+
+	// Send pings to the peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+
+	// Size of the buffered channel used to queue outbound messages per client.
+	sendBufferSize = 256
+)
+
+var clientSeq int64
+
+// nextClientID returns a process-unique identifier, used to stamp the From
+// field of outgoing envelopes and to key consistent-hash routing.
+func nextClientID() string {
+	return fmt.Sprintf("client-%d", atomic.AddInt64(&clientSeq, 1))
+}
+
+// Client wraps a single WebSocket connection. Reads and writes are owned by
+// separate goroutines (readPump and writePump): outbound messages are queued
+// on send rather than written directly by whichever goroutine is
+// broadcasting, so one slow or dead peer can no longer stall delivery to the
+// rest of the room, and WriteMessage is only ever called from writePump.
+//
+// A connection may be subscribed to several rooms at once. subscriptions is
+// only ever read or written from this Client's own readPump goroutine, so it
+// needs no lock of its own.
+type Client struct {
+	conn *websocket.Conn
+
+	// send is a buffered channel of already-encoded outbound frames, shared
+	// across every room this client is subscribed to. Only readPump's own
+	// goroutine, via done, may close it.
+	send chan []byte
+	done chan struct{}
+
+	id       string
+	registry *RoomRegistry
+	codec    Codec
+	// frameType is the websocket opcode codec output must be sent as
+	// (cached from codec.FrameType() so writePump doesn't call it per
+	// message).
+	frameType int
+
+	subscriptions map[string]*Hub
+}
+
+// newClient creates a Client for conn, ready to register for rooms but not
+// yet subscribed to any.
+func newClient(conn *websocket.Conn, registry *RoomRegistry) *Client {
+	return &Client{
+		conn:          conn,
+		send:          make(chan []byte, sendBufferSize),
+		done:          make(chan struct{}),
+		id:            nextClientID(),
+		registry:      registry,
+		codec:         registry.cfg.Codec,
+		frameType:     registry.cfg.Codec.FrameType(),
+		subscriptions: make(map[string]*Hub),
+	}
+}
+
+// writePump pumps messages from the client's send channel to the WebSocket
+// connection, interleaving periodic ping frames so dead peers are detected
+// even when nothing is being broadcast. There is at most one writePump per
+// connection, and it is the only goroutine allowed to call WriteMessage.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(c.frameType, message); err != nil {
+				return
+			}
+
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// readPump pumps frames from the WebSocket connection through
+// dispatchMessage. It extends the read deadline on every pong, so a peer
+// that stops responding to pings is dropped once pongWait elapses.
+func (c *Client) readPump() {
+	defer func() {
+		c.leaveAll()
+		close(c.done)
+		c.conn.Close()
+	}()
+
+	if max := c.registry.cfg.MaxMessageSize; max > 0 {
+		c.conn.SetReadLimit(max)
+	}
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			// If there's an error (e.g., client closed connection), break the loop.
+			// The deferred function above handles cleanup.
+			break
+		}
+
+		c.dispatchMessage(message)
+	}
+}
+
+// dispatchMessage decodes a raw frame and routes it by its envelope type.
+func (c *Client) dispatchMessage(raw []byte) {
+	env, err := c.codec.Decode(raw)
+	if err != nil {
+		c.sendError("", fmt.Sprintf("invalid envelope: %v", err))
+		return
+	}
+
+	switch env.Type {
+	case MsgSubscribe:
+		c.subscribe(env)
+	case MsgUnsubscribe:
+		c.unsubscribe(env)
+	case MsgPublish:
+		c.publish(env)
+	case MsgPing:
+		c.sendEnvelope(Envelope{Type: MsgPing, ID: env.ID, From: c.id})
+	default:
+		c.sendError(env.ID, fmt.Sprintf("unsupported message type %q", env.Type))
+	}
+}
+
+// subscribe joins the connection to env.Room, creating it with env.Mode if
+// it doesn't exist yet, and announces the join to the room's other members.
+func (c *Client) subscribe(env Envelope) {
+	if env.Room == "" {
+		c.sendError(env.ID, "subscribe requires a room")
+		return
+	}
+	if _, ok := c.subscriptions[env.Room]; ok {
+		return
+	}
+
+	mode, err := ParseRoutingMode(env.Mode)
+	if err != nil {
+		c.sendError(env.ID, err.Error())
+		return
+	}
+
+	hub := c.registry.getOrCreateHub(env.Room, mode)
+	hub.register <- c
+	c.subscriptions[env.Room] = hub
+
+	c.announcePresence(env.Room, hub, "join")
+}
+
+// unsubscribe leaves env.Room without closing the connection.
+func (c *Client) unsubscribe(env Envelope) {
+	hub, ok := c.subscriptions[env.Room]
+	if !ok {
+		c.sendError(env.ID, fmt.Sprintf("not subscribed to room %q", env.Room))
+		return
+	}
+
+	// Announce the leave while we're still a registered member: once
+	// hub.unregister is sent, this may be the room's last client, in which
+	// case the hub tears itself down and nothing will ever read
+	// hub.broadcast again.
+	c.announcePresence(env.Room, hub, "leave")
+	hub.unregister <- c
+	delete(c.subscriptions, env.Room)
+}
+
+// publish routes env.Payload to env.Room according to the room's routing
+// mode. The client must have already subscribed.
+func (c *Client) publish(env Envelope) {
+	hub, ok := c.subscriptions[env.Room]
+	if !ok {
+		c.sendError(env.ID, fmt.Sprintf("not subscribed to room %q", env.Room))
+		return
+	}
+
+	env.From = c.id
+	data, err := c.codec.Encode(env)
+	if err != nil {
+		c.sendError(env.ID, fmt.Sprintf("encode error: %v", err))
+		return
+	}
+
+	hub.broadcast <- broadcastMessage{sender: c, data: data, key: env.Key}
+}
+
+// announcePresence broadcasts a join/leave notification for this client to
+// the rest of room.
+func (c *Client) announcePresence(room string, hub *Hub, event string) {
+	payload, err := json.Marshal(PresenceEvent{Event: event, From: c.id})
+	if err != nil {
+		return
+	}
+	data, err := c.codec.Encode(Envelope{Type: MsgPresence, Room: room, Payload: payload, From: c.id})
+	if err != nil {
+		return
+	}
+	hub.broadcast <- broadcastMessage{sender: c, data: data}
+}
+
+// leaveAll unsubscribes the client from every room it is in, announcing a
+// leave event to each. Called once, from readPump's cleanup, on disconnect.
+func (c *Client) leaveAll() {
+	for room, hub := range c.subscriptions {
+		// Same ordering as unsubscribe: announce before unregistering, so
+		// the send can't land after the hub has already torn itself down.
+		c.announcePresence(room, hub, "leave")
+		hub.unregister <- c
+	}
+	c.subscriptions = nil
+}
+
+// sendEnvelope encodes env and queues it for delivery to this client only.
+// The send is non-blocking: a client that isn't reading its own control
+// replies doesn't get to stall its own writePump.
+func (c *Client) sendEnvelope(env Envelope) {
+	data, err := c.codec.Encode(env)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
+func (c *Client) sendError(id, message string) {
+	payload, _ := json.Marshal(message)
+	c.sendEnvelope(Envelope{Type: MsgError, ID: id, Payload: payload, From: c.id})
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// Config holds the tunables for how connections are upgraded and how
+// envelopes on them are encoded.
+type Config struct {
+	// AllowedOrigins lists origins allowed to open a WebSocket connection.
+	// An entry is either an exact origin ("https://example.com") or a
+	// wildcard subdomain ("*.example.com"). An empty list allows every
+	// origin, matching the server's old CheckOrigin: true behavior - a CSRF
+	// risk that should not be relied on in production.
+	AllowedOrigins []string
+
+	// EnableCompression negotiates per-message deflate (RFC 7692) when the
+	// peer supports it.
+	EnableCompression bool
+
+	ReadBufferSize  int
+	WriteBufferSize int
+
+	// HandshakeTimeout bounds how long the initial WebSocket handshake may
+	// take. Zero means no timeout.
+	HandshakeTimeout time.Duration
+
+	// MaxMessageSize caps the size of a single incoming frame; a peer that
+	// exceeds it is disconnected. Zero means unlimited.
+	MaxMessageSize int64
+
+	Subprotocols []string
+
+	// Codec is the wire format connections decode and encode envelopes
+	// with.
+	Codec Codec
+
+	// Backplane, if set, is used to forward room traffic between multiple
+	// gostream processes. Nil means each process only knows about its own
+	// connections, which is fine for a single instance.
+	Backplane Backplane
+}
+
+// DefaultConfig returns the Config the server used before any of this was
+// configurable: every origin allowed, no compression, library-default
+// buffer sizes, and JSONCodec.
+func DefaultConfig() Config {
+	return Config{
+		Codec: JSONCodec{},
+	}
+}
+
+// LoadConfig builds a Config from environment variables (ALLOWED_ORIGINS,
+// ENABLE_COMPRESSION, READ_BUFFER_SIZE, WRITE_BUFFER_SIZE,
+// HANDSHAKE_TIMEOUT, MAX_MESSAGE_SIZE, SUBPROTOCOLS, REDIS_ADDR), alongside
+// the existing PORT. Anything unset, or that fails to parse, falls back to
+// DefaultConfig.
+func LoadConfig() Config {
+	cfg := DefaultConfig()
+
+	if v := os.Getenv("ALLOWED_ORIGINS"); v != "" {
+		cfg.AllowedOrigins = strings.Split(v, ",")
+	}
+	if v := os.Getenv("ENABLE_COMPRESSION"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			cfg.EnableCompression = b
+		}
+	}
+	if v := os.Getenv("READ_BUFFER_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.ReadBufferSize = n
+		}
+	}
+	if v := os.Getenv("WRITE_BUFFER_SIZE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			cfg.WriteBufferSize = n
+		}
+	}
+	if v := os.Getenv("HANDSHAKE_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			cfg.HandshakeTimeout = d
+		}
+	}
+	if v := os.Getenv("MAX_MESSAGE_SIZE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			cfg.MaxMessageSize = n
+		}
+	}
+	if v := os.Getenv("SUBPROTOCOLS"); v != "" {
+		cfg.Subprotocols = strings.Split(v, ",")
+	}
+	if v := os.Getenv("REDIS_ADDR"); v != "" {
+		cfg.Backplane = NewRedisBackplane(redis.NewClient(&redis.Options{Addr: v}))
+	}
+
+	return cfg
+}
+
+// buildUpgrader constructs a gorilla websocket.Upgrader from cfg. All
+// connections upgraded by the same RoomRegistry share one WriteBufferPool
+// rather than each allocating its own write buffer.
+func buildUpgrader(cfg Config) websocket.Upgrader {
+	return websocket.Upgrader{
+		ReadBufferSize:    cfg.ReadBufferSize,
+		WriteBufferSize:   cfg.WriteBufferSize,
+		WriteBufferPool:   &sync.Pool{},
+		HandshakeTimeout:  cfg.HandshakeTimeout,
+		Subprotocols:      cfg.Subprotocols,
+		EnableCompression: cfg.EnableCompression,
+		CheckOrigin:       checkOrigin(cfg.AllowedOrigins),
+	}
+}
+
+// checkOrigin builds a websocket.Upgrader.CheckOrigin func that allows a
+// request whose Origin header matches an entry in allowed, either exactly
+// or against a "*.example.com" wildcard. An empty allowed list allows every
+// origin.
+func checkOrigin(allowed []string) func(*http.Request) bool {
+	if len(allowed) == 0 {
+		return func(*http.Request) bool { return true }
+	}
+
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return false
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return false
+		}
+
+		for _, a := range allowed {
+			if a == origin || a == u.Host {
+				return true
+			}
+			if suffix, ok := strings.CutPrefix(a, "*."); ok {
+				if strings.HasSuffix(u.Host, "."+suffix) || u.Host == suffix {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCheckOriginEmptyAllowsEverything(t *testing.T) {
+	check := checkOrigin(nil)
+	req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+	req.Header.Set("Origin", "https://anything.example")
+	if !check(req) {
+		t.Fatal("empty allowlist should allow every origin")
+	}
+}
+
+func TestCheckOriginExactAndWildcard(t *testing.T) {
+	check := checkOrigin([]string{"https://app.example.com", "*.example.org"})
+
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://evil.example.com", false},
+		{"https://sub.example.org", true},
+		{"https://example.org", true},
+		{"https://example.org.evil.com", false},
+		{"", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		if c.origin != "" {
+			req.Header.Set("Origin", c.origin)
+		}
+		if got := check(req); got != c.want {
+			t.Errorf("checkOrigin allows %q = %v, want %v", c.origin, got, c.want)
+		}
+	}
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	for k, v := range map[string]string{
+		"ALLOWED_ORIGINS":    "https://a.com,https://b.com",
+		"ENABLE_COMPRESSION": "true",
+		"READ_BUFFER_SIZE":   "4096",
+		"WRITE_BUFFER_SIZE":  "8192",
+		"HANDSHAKE_TIMEOUT":  "5s",
+		"MAX_MESSAGE_SIZE":   "1024",
+		"SUBPROTOCOLS":       "v1,v2",
+	} {
+		t.Setenv(k, v)
+	}
+
+	cfg := LoadConfig()
+
+	if want := []string{"https://a.com", "https://b.com"}; !equalStrings(cfg.AllowedOrigins, want) {
+		t.Errorf("AllowedOrigins = %v, want %v", cfg.AllowedOrigins, want)
+	}
+	if !cfg.EnableCompression {
+		t.Error("EnableCompression = false, want true")
+	}
+	if cfg.ReadBufferSize != 4096 {
+		t.Errorf("ReadBufferSize = %d, want 4096", cfg.ReadBufferSize)
+	}
+	if cfg.WriteBufferSize != 8192 {
+		t.Errorf("WriteBufferSize = %d, want 8192", cfg.WriteBufferSize)
+	}
+	if cfg.HandshakeTimeout != 5*time.Second {
+		t.Errorf("HandshakeTimeout = %v, want 5s", cfg.HandshakeTimeout)
+	}
+	if cfg.MaxMessageSize != 1024 {
+		t.Errorf("MaxMessageSize = %d, want 1024", cfg.MaxMessageSize)
+	}
+	if want := []string{"v1", "v2"}; !equalStrings(cfg.Subprotocols, want) {
+		t.Errorf("Subprotocols = %v, want %v", cfg.Subprotocols, want)
+	}
+}
+
+func TestLoadConfigDefaultsOnUnsetOrInvalid(t *testing.T) {
+	os.Unsetenv("ALLOWED_ORIGINS")
+	t.Setenv("ENABLE_COMPRESSION", "not-a-bool")
+	t.Setenv("READ_BUFFER_SIZE", "not-a-number")
+
+	cfg := LoadConfig()
+
+	if len(cfg.AllowedOrigins) != 0 {
+		t.Errorf("AllowedOrigins = %v, want empty", cfg.AllowedOrigins)
+	}
+	if cfg.EnableCompression {
+		t.Error("EnableCompression should stay false when ENABLE_COMPRESSION fails to parse")
+	}
+	if cfg.ReadBufferSize != 0 {
+		t.Errorf("ReadBufferSize = %d, want 0 when READ_BUFFER_SIZE fails to parse", cfg.ReadBufferSize)
+	}
+	if cfg.Backplane != nil {
+		t.Error("Backplane should stay nil when REDIS_ADDR is unset")
+	}
+}
+
+func TestLoadConfigRedisAddrWiresBackplane(t *testing.T) {
+	t.Setenv("REDIS_ADDR", "localhost:6379")
+
+	cfg := LoadConfig()
+
+	if _, ok := cfg.Backplane.(*RedisBackplane); !ok {
+		t.Fatalf("Backplane = %T, want *RedisBackplane when REDIS_ADDR is set", cfg.Backplane)
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
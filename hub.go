@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+)
+
+// broadcastMessage is a message pending delivery according to the Hub's
+// RoutingMode. sender is nil for a message fanned in from the backplane,
+// which marks it as already local to every other instance and exempts it
+// from being forwarded back out to the backplane.
+type broadcastMessage struct {
+	sender *Client
+	data   []byte
+	// key is the Envelope's routing key, used by deliverConsistentHash. It
+	// is carried alongside data, rather than re-extracted from it, because
+	// data is already codec-encoded and may not be JSON (see MsgpackCodec).
+	key string
+}
+
+// backplaneFrame wraps a message published onto the Backplane so a Hub can
+// recognize and drop its own messages echoed back to it.
+type backplaneFrame struct {
+	Instance string `json:"instance"`
+	Data     []byte `json:"data"`
+	Key      string `json:"key,omitempty"`
+}
+
+// RoomInfo is a point-in-time snapshot of a room, used by the admin API.
+type RoomInfo struct {
+	Room    string `json:"room"`
+	Mode    string `json:"mode"`
+	Clients int    `json:"clients"`
+}
+
+// Hub owns the client set for a single room and is the only goroutine that
+// ever touches it, so no locking is needed on the hot broadcast path. It is
+// driven entirely by its register, unregister, and broadcast channels and
+// exits on its own once the last client leaves.
+type Hub struct {
+	name string
+	mode RoutingMode
+
+	clients map[*Client]bool
+	// order is a stable ordering of clients used by RoundRobin; clients is
+	// a set and ranging over it gives no ordering guarantee.
+	order   []*Client
+	rrIndex int
+
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan broadcastMessage
+	info       chan chan RoomInfo
+
+	registry *RoomRegistry
+
+	// pending counts registrations promised by registry.getOrCreateHub that
+	// haven't reached the register case below yet. It is owned by
+	// registry.lock, not by this goroutine, so it must only be read or
+	// written via the registry's doneRegistering/removeHubIfEmpty methods.
+	pending int
+}
+
+// newHub creates a Hub for room, owned by registry. Call run on it in its
+// own goroutine.
+func newHub(room string, mode RoutingMode, registry *RoomRegistry) *Hub {
+	return &Hub{
+		name:       room,
+		mode:       mode,
+		clients:    make(map[*Client]bool),
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan broadcastMessage),
+		info:       make(chan chan RoomInfo),
+		registry:   registry,
+	}
+}
+
+// run is the Hub's event loop. It returns, and deregisters itself from the
+// registry, once the room has no clients left.
+func (h *Hub) run() {
+	var fromBackplane <-chan []byte
+	if bp := h.registry.cfg.Backplane; bp != nil {
+		ch, err := bp.Subscribe(h.name)
+		if err != nil {
+			slog.Error("backplane subscribe failed", "room", h.name, "error", err)
+		} else {
+			fromBackplane = ch
+			defer bp.Unsubscribe(h.name)
+		}
+	}
+
+	for {
+		select {
+		case c := <-h.register:
+			h.addClient(c)
+			h.registry.doneRegistering(h)
+			clientsTotal.WithLabelValues(h.name).Set(float64(len(h.clients)))
+			slog.Info("client connected", "room", h.name, "conn_id", c.id, "mode", h.mode, "clients", len(h.clients))
+
+		case c := <-h.unregister:
+			if _, ok := h.clients[c]; !ok {
+				continue
+			}
+			h.removeClient(c)
+			clientsTotal.WithLabelValues(h.name).Set(float64(len(h.clients)))
+			slog.Info("client disconnected", "room", h.name, "conn_id", c.id)
+
+			// removeHubIfEmpty makes the "am I still the live hub for this
+			// room" decision under registry.lock, atomically with respect to
+			// getOrCreateHub: without that, a concurrent getOrCreateHub call
+			// could hand out this Hub just before it tore itself down, and
+			// the caller's send on h.register would block forever.
+			if h.registry.removeHubIfEmpty(h) {
+				return
+			}
+
+		case m := <-h.broadcast:
+			// Only a message that originated on this instance (sender != nil)
+			// counts as "received"; one fanned in from the backplane was
+			// already counted as received by whichever instance published it.
+			if m.sender != nil {
+				messagesReceivedTotal.WithLabelValues(h.name).Inc()
+				messageBytes.Observe(float64(len(m.data)))
+			}
+
+			h.deliver(m)
+
+			// Forward it to the other instances too, unless it's the thing
+			// we're forwarding that arrived from them in the first place.
+			if m.sender != nil {
+				h.publishToBackplane(m.data, m.key)
+			}
+
+			// deliver may have dropped a client whose send buffer was full
+			// (see Hub.send); if that was the room's last client, tear the
+			// hub down the same way the unregister case does, rather than
+			// leaving it selecting on channels nobody will ever write to
+			// again.
+			if h.registry.removeHubIfEmpty(h) {
+				return
+			}
+
+		case raw, ok := <-fromBackplane:
+			if !ok {
+				fromBackplane = nil
+				continue
+			}
+			var frame backplaneFrame
+			if err := json.Unmarshal(raw, &frame); err != nil {
+				slog.Warn("discarding malformed backplane frame", "room", h.name, "error", err)
+				continue
+			}
+			if frame.Instance == h.registry.instanceID {
+				// Our own publish, echoed back by the backplane.
+				continue
+			}
+			h.deliver(broadcastMessage{data: frame.Data, key: frame.Key})
+			if h.registry.removeHubIfEmpty(h) {
+				return
+			}
+
+		case reply := <-h.info:
+			reply <- RoomInfo{Room: h.name, Mode: h.mode.String(), Clients: len(h.clients)}
+		}
+	}
+}
+
+// deliver routes m to the room's clients according to the Hub's RoutingMode.
+func (h *Hub) deliver(m broadcastMessage) {
+	switch h.mode {
+	case RoundRobin:
+		h.deliverRoundRobin(m)
+	case ConsistentHash:
+		h.deliverConsistentHash(m)
+	default:
+		h.deliverBroadcast(m)
+	}
+}
+
+// publishToBackplane forwards data to the other instances sharing this room,
+// stamped with this instance's ID so they (and we, if the backplane echoes
+// our own publish back) can tell it apart from a genuinely new message.
+func (h *Hub) publishToBackplane(data []byte, key string) {
+	bp := h.registry.cfg.Backplane
+	if bp == nil {
+		return
+	}
+	frame, err := json.Marshal(backplaneFrame{Instance: h.registry.instanceID, Data: data, Key: key})
+	if err != nil {
+		return
+	}
+	if err := bp.Publish(h.name, frame); err != nil {
+		slog.Error("backplane publish failed", "room", h.name, "error", err)
+	}
+}
+
+func (h *Hub) addClient(c *Client) {
+	h.clients[c] = true
+	h.order = append(h.order, c)
+}
+
+// removeClient drops c from the room. It does not touch c.send: a
+// connection can be subscribed to several rooms sharing one send channel,
+// so only the client itself, on final disconnect, may close it. It is a
+// no-op if c is not currently a member.
+func (h *Hub) removeClient(c *Client) {
+	if _, ok := h.clients[c]; !ok {
+		return
+	}
+	delete(h.clients, c)
+	for i, oc := range h.order {
+		if oc == c {
+			h.order = append(h.order[:i], h.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// send delivers data to c, dropping c if its buffer is full. It reports
+// whether delivery succeeded.
+func (h *Hub) send(c *Client, data []byte) bool {
+	select {
+	case c.send <- data:
+		messagesRelayedTotal.WithLabelValues(h.name).Inc()
+		return true
+	default:
+		clientSendDroppedTotal.WithLabelValues(h.name).Inc()
+		slog.Warn("client send buffer full, dropping client", "room", h.name, "conn_id", c.id)
+		h.removeClient(c)
+		clientsTotal.WithLabelValues(h.name).Set(float64(len(h.clients)))
+		return false
+	}
+}
+
+// deliverBroadcast sends m to every client in the room other than its sender.
+func (h *Hub) deliverBroadcast(m broadcastMessage) {
+	for c := range h.clients {
+		if c == m.sender {
+			continue
+		}
+		h.send(c, m.data)
+	}
+}
+
+// deliverRoundRobin sends m to exactly one client, advancing h.rrIndex
+// through the stable client order and skipping the sender and any client
+// whose buffer is currently full.
+func (h *Hub) deliverRoundRobin(m broadcastMessage) {
+	n := len(h.order)
+	for i := 0; i < n; i++ {
+		h.rrIndex = (h.rrIndex + 1) % n
+		c := h.order[h.rrIndex]
+		if c == m.sender {
+			continue
+		}
+		if h.send(c, m.data) {
+			return
+		}
+	}
+}
+
+// deliverConsistentHash sends m to exactly one client, chosen by hashing the
+// message's routing key onto a ring built from the room's current clients
+// (excluding the sender).
+func (h *Hub) deliverConsistentHash(m broadcastMessage) {
+	candidates := make(map[*Client]bool, len(h.clients))
+	for c := range h.clients {
+		if c != m.sender {
+			candidates[c] = true
+		}
+	}
+
+	c := newHashRing(candidates).get(routingKey(m.key, m.data))
+	if c != nil {
+		h.send(c, m.data)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestHub starts a Hub of mode through a RoomRegistry, the same way
+// production code reaches one, so the registry's bookkeeping (pending
+// counts, map entries) is exercised too. getOrCreateHub already starts the
+// Hub's run loop; callers must not start a second one.
+func newTestHub(t *testing.T, mode RoutingMode) (*RoomRegistry, *Hub) {
+	t.Helper()
+	r := NewRoomRegistry(DefaultConfig())
+	h := r.getOrCreateHub("room", mode)
+	return r, h
+}
+
+// hubStillRegistered reports whether h is still the live Hub for its room,
+// taking registry.lock the same way the registry's own methods do so this
+// can be polled from a test without racing Hub.run's own access to h.
+func hubStillRegistered(r *RoomRegistry, h *Hub) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.hubs[h.name] == h
+}
+
+// newTestClient builds a Client with buffered channels, sidestepping
+// newClient's dependency on a real *websocket.Conn.
+func newTestClient() *Client {
+	return &Client{
+		send:          make(chan []byte, sendBufferSize),
+		done:          make(chan struct{}),
+		id:            nextClientID(),
+		codec:         JSONCodec{},
+		subscriptions: make(map[string]*Hub),
+	}
+}
+
+func recvWithTimeout(t *testing.T, ch chan []byte) []byte {
+	t.Helper()
+	select {
+	case msg := <-ch:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return nil
+	}
+}
+
+func TestHubBroadcastSkipsSender(t *testing.T) {
+	_, h := newTestHub(t, Broadcast)
+
+	a, b := newTestClient(), newTestClient()
+	h.register <- a
+	h.register <- b
+
+	h.broadcast <- broadcastMessage{sender: a, data: []byte("hi")}
+
+	if got := recvWithTimeout(t, b.send); string(got) != "hi" {
+		t.Fatalf("b.send = %q, want %q", got, "hi")
+	}
+	select {
+	case got := <-a.send:
+		t.Fatalf("sender should not receive its own broadcast, got %q", got)
+	default:
+	}
+
+	h.unregister <- a
+	h.unregister <- b
+}
+
+func TestHubRoundRobinCyclesClients(t *testing.T) {
+	r, h := newTestHub(t, RoundRobin)
+
+	a, b := newTestClient(), newTestClient()
+	h.register <- a
+	h.register <- b
+
+	sender := newTestClient()
+	seen := map[*Client]bool{}
+	for i := 0; i < 2; i++ {
+		h.broadcast <- broadcastMessage{sender: sender, data: []byte("msg")}
+	}
+	for _, c := range []*Client{a, b} {
+		select {
+		case <-c.send:
+			seen[c] = true
+		case <-time.After(time.Second):
+		}
+	}
+	if len(seen) != 2 {
+		t.Fatalf("expected round-robin to reach both clients over two messages, got %d", len(seen))
+	}
+
+	h.unregister <- a
+	h.unregister <- b
+	r.removeHubIfEmpty(h)
+}
+
+// TestHubUnregisterLastClientDoesNotBlockBroadcast reproduces the scenario
+// the maintainer reported: a client alone in a room announces a leave (a
+// broadcast send) before being unregistered. If the ordering regresses back
+// to unregister-then-announce, the hub has already torn itself down by the
+// time the broadcast send happens and this test hangs.
+func TestHubUnregisterLastClientDoesNotBlockBroadcast(t *testing.T) {
+	_, h := newTestHub(t, Broadcast)
+
+	a := newTestClient()
+	h.register <- a
+
+	done := make(chan struct{})
+	go func() {
+		h.broadcast <- broadcastMessage{sender: a, data: []byte("leave")}
+		h.unregister <- a
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("broadcast-then-unregister on a solo client deadlocked")
+	}
+}
+
+// TestGetOrCreateHubRaceWithTeardown reproduces the TOCTOU the maintainer
+// flagged: a client subscribing to a room just as its only other member
+// leaves must never be handed a Hub that's already torn itself down.
+func TestGetOrCreateHubRaceWithTeardown(t *testing.T) {
+	r := NewRoomRegistry(DefaultConfig())
+	h := r.getOrCreateHub("room", Broadcast)
+
+	a := newTestClient()
+	h.register <- a
+
+	// a leaves, making the room empty and racing the teardown below against
+	// a concurrent subscribe for the same room.
+	h.unregister <- a
+
+	h2 := r.getOrCreateHub("room", Broadcast)
+	b := newTestClient()
+
+	done := make(chan struct{})
+	go func() {
+		h2.register <- b
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("register on a hub handed out by getOrCreateHub deadlocked, hub must have already torn itself down")
+	}
+
+	h2.unregister <- b
+}
+
+// TestHubTeardownOnFullBufferDrop reproduces the maintainer's report: Hub.send
+// dropping the room's last client because its buffer was full must tear the
+// hub down the same way an explicit unregister does, instead of leaving its
+// goroutine selecting on channels nobody will ever write to again.
+func TestHubTeardownOnFullBufferDrop(t *testing.T) {
+	r, h := newTestHub(t, Broadcast)
+
+	a := newTestClient()
+	h.register <- a
+
+	// Fill a's buffer to capacity without draining it, so the next
+	// delivery attempt to a finds it full and drops a.
+	for i := 0; i < sendBufferSize; i++ {
+		a.send <- []byte("filler")
+	}
+
+	sender := newTestClient()
+	h.broadcast <- broadcastMessage{sender: sender, data: []byte("drop-me")}
+
+	deadline := time.Now().Add(time.Second)
+	for hubStillRegistered(r, h) {
+		if time.Now().After(deadline) {
+			t.Fatal("hub was not torn down after its last client was dropped for a full send buffer")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRemoveHubIfEmptyRespectsPendingRegistration(t *testing.T) {
+	r := NewRoomRegistry(DefaultConfig())
+	h := r.getOrCreateHub("room", Broadcast)
+
+	if r.removeHubIfEmpty(h) {
+		t.Fatal("removeHubIfEmpty should refuse to remove a hub with a pending registration")
+	}
+
+	r.doneRegistering(h)
+	if !r.removeHubIfEmpty(h) {
+		t.Fatal("removeHubIfEmpty should remove an empty hub with no pending registrations")
+	}
+}
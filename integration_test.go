@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer starts a real HTTP server wired up exactly like main, so
+// tests exercise the actual upgrade, pump, and dispatch code paths rather
+// than calling Hub/Client methods directly.
+func newTestServer(t *testing.T) (*httptest.Server, string) {
+	t.Helper()
+	registry := NewRoomRegistry(DefaultConfig())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", registry.handleWebSocket)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	return srv, wsURL
+}
+
+func dialTestServer(t *testing.T, wsURL string) *websocket.Conn {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial %s: %v", wsURL, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readEnvelope(t *testing.T, conn *websocket.Conn) Envelope {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, data, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatalf("read envelope: %v", err)
+	}
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	return env
+}
+
+func sendEnvelope(t *testing.T, conn *websocket.Conn, env Envelope) {
+	t.Helper()
+	data, err := json.Marshal(env)
+	if err != nil {
+		t.Fatalf("encode envelope: %v", err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		t.Fatalf("write envelope: %v", err)
+	}
+}
+
+func TestIntegrationSubscribePublishPresence(t *testing.T) {
+	_, wsURL := newTestServer(t)
+
+	a := dialTestServer(t, wsURL)
+	sendEnvelope(t, a, Envelope{Type: MsgSubscribe, Room: "lobby"})
+
+	b := dialTestServer(t, wsURL)
+	sendEnvelope(t, b, Envelope{Type: MsgSubscribe, Room: "lobby"})
+
+	// a should see b's join announced.
+	env := readEnvelope(t, a)
+	if env.Type != MsgPresence {
+		t.Fatalf("expected a presence envelope, got %+v", env)
+	}
+	var presence PresenceEvent
+	if err := json.Unmarshal(env.Payload, &presence); err != nil {
+		t.Fatalf("decode presence payload: %v", err)
+	}
+	if presence.Event != "join" {
+		t.Fatalf("presence.Event = %q, want join", presence.Event)
+	}
+
+	sendEnvelope(t, a, Envelope{Type: MsgPublish, Room: "lobby", Payload: json.RawMessage(`"hello"`)})
+
+	env = readEnvelope(t, b)
+	if env.Type != MsgPublish {
+		t.Fatalf("expected a publish envelope, got %+v", env)
+	}
+	var payload string
+	if err := json.Unmarshal(env.Payload, &payload); err != nil || payload != "hello" {
+		t.Fatalf("payload = %q, err %v, want hello", payload, err)
+	}
+}
+
+// TestIntegrationSoloClientUnsubscribeDoesNotHang reproduces the maintainer's
+// report end to end: a client alone in a room that unsubscribes (or
+// disconnects) must not hang its own connection. If the presence-ordering
+// bug regresses, this client's subsequent ping never gets a reply and the
+// test times out.
+func TestIntegrationSoloClientUnsubscribeDoesNotHang(t *testing.T) {
+	_, wsURL := newTestServer(t)
+
+	conn := dialTestServer(t, wsURL)
+	sendEnvelope(t, conn, Envelope{Type: MsgSubscribe, Room: "solo"})
+	sendEnvelope(t, conn, Envelope{Type: MsgUnsubscribe, Room: "solo"})
+
+	sendEnvelope(t, conn, Envelope{Type: MsgPing, ID: "ping-1"})
+	env := readEnvelope(t, conn)
+	if env.Type != MsgPing || env.ID != "ping-1" {
+		t.Fatalf("expected ping reply after unsubscribing alone, got %+v", env)
+	}
+}
+
+func TestIntegrationPublishWithoutSubscribeErrors(t *testing.T) {
+	_, wsURL := newTestServer(t)
+
+	conn := dialTestServer(t, wsURL)
+	sendEnvelope(t, conn, Envelope{Type: MsgPublish, Room: "lobby", ID: "p1", Payload: json.RawMessage(`"x"`)})
+
+	env := readEnvelope(t, conn)
+	if env.Type != MsgError || env.ID != "p1" {
+		t.Fatalf("expected an error envelope for p1, got %+v", env)
+	}
+}
+
+func TestIntegrationRejectsUnallowedOrigin(t *testing.T) {
+	registry := NewRoomRegistry(Config{
+		Codec:          JSONCodec{},
+		AllowedOrigins: []string{"https://allowed.example"},
+	})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", registry.handleWebSocket)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws"
+	header := http.Header{"Origin": []string{"https://not-allowed.example"}}
+	_, resp, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err == nil {
+		t.Fatal("expected the handshake to be rejected for a disallowed origin")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		status := "<nil response>"
+		if resp != nil {
+			status = resp.Status
+		}
+		t.Fatalf("expected 403 Forbidden, got %s", status)
+	}
+}
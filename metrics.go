@@ -0,0 +1,46 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Prometheus metrics for rooms and connections, scraped from /metrics.
+var (
+	roomsTotal = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "gostream_rooms_total",
+		Help: "Number of rooms currently active.",
+	})
+
+	clientsTotal = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "gostream_clients_total",
+		Help: "Number of clients currently subscribed to a room.",
+	}, []string{"room"})
+
+	messagesReceivedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gostream_messages_received_total",
+		Help: "Messages published into a room by its clients.",
+	}, []string{"room"})
+
+	messagesRelayedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gostream_messages_relayed_total",
+		Help: "Messages relayed from a room to a client.",
+	}, []string{"room"})
+
+	clientSendDroppedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gostream_client_send_dropped_total",
+		Help: "Clients dropped from a room because their send buffer was full.",
+	}, []string{"room"})
+
+	messageBytes = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gostream_message_bytes",
+		Help:    "Size in bytes of messages published into a room.",
+		Buckets: prometheus.ExponentialBuckets(32, 4, 8),
+	})
+
+	handshakeDurationSeconds = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "gostream_handshake_duration_seconds",
+		Help:    "Time taken to upgrade an HTTP request to a WebSocket connection.",
+		Buckets: prometheus.DefBuckets,
+	})
+)
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// MessageType identifies the kind of control frame an Envelope carries.
+type MessageType string
+
+const (
+	// MsgSubscribe joins the connection to Room, creating it if necessary.
+	MsgSubscribe MessageType = "subscribe"
+	// MsgUnsubscribe leaves Room. The connection stays open.
+	MsgUnsubscribe MessageType = "unsubscribe"
+	// MsgPublish delivers Payload to Room according to its routing mode.
+	MsgPublish MessageType = "publish"
+	// MsgPresence notifies room members that a peer joined or left. It is
+	// only ever sent by the server, never accepted from a client.
+	MsgPresence MessageType = "presence"
+	// MsgPing is an application-level heartbeat, answered with another
+	// MsgPing envelope carrying the same ID.
+	MsgPing MessageType = "ping"
+	// MsgError reports that a frame could not be processed.
+	MsgError MessageType = "error"
+)
+
+// Envelope is the wire format for every frame exchanged over a connection.
+// A single connection can be subscribed to several rooms at once, so Room
+// rather than the connection itself tells frames apart.
+type Envelope struct {
+	Type MessageType `json:"type"`
+	Room string      `json:"room,omitempty"`
+	// Payload is opaque to the hub; publishers and subscribers agree on its
+	// shape between themselves.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	From    string          `json:"from,omitempty"`
+	// Mode is the RoutingMode.String() to use for Room; only read from a
+	// subscribe frame, and only takes effect the first time Room is created.
+	Mode string `json:"mode,omitempty"`
+	// Key is the routing key for ConsistentHash rooms: publishes carrying
+	// the same Key are delivered to the same client for as long as that
+	// client stays in the room. Ignored by other routing modes.
+	Key string `json:"key,omitempty"`
+}
+
+// PresenceEvent is the Payload of a MsgPresence envelope.
+type PresenceEvent struct {
+	Event string `json:"event"` // "join" or "leave"
+	From  string `json:"from"`
+}
+
+// Codec encodes and decodes the envelopes exchanged over a connection, so
+// the wire format is pluggable independently of the subscribe/publish/
+// presence protocol built on top of it.
+type Codec interface {
+	Encode(Envelope) ([]byte, error)
+	Decode(data []byte) (Envelope, error)
+	// FrameType is the websocket opcode (websocket.TextMessage or
+	// websocket.BinaryMessage) that Encode's output must be sent as. A
+	// codec whose output isn't valid UTF-8 must report BinaryMessage, or
+	// strict clients and proxies that validate text frames will reject it.
+	FrameType() int
+}
+
+// JSONCodec is the default Codec: human-readable, the envelope's native
+// encoding/json tags apply directly.
+type JSONCodec struct{}
+
+func (JSONCodec) Encode(e Envelope) ([]byte, error) { return json.Marshal(e) }
+
+func (JSONCodec) Decode(data []byte) (Envelope, error) {
+	var e Envelope
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
+
+func (JSONCodec) FrameType() int { return websocket.TextMessage }
+
+// MsgpackCodec is a compact binary alternative to JSONCodec, useful for
+// high-throughput rooms where shaving bytes off every frame matters more
+// than being able to read them off the wire by eye.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) Encode(e Envelope) ([]byte, error) { return msgpack.Marshal(e) }
+
+func (MsgpackCodec) Decode(data []byte) (Envelope, error) {
+	var e Envelope
+	err := msgpack.Unmarshal(data, &e)
+	return e, err
+}
+
+func (MsgpackCodec) FrameType() int { return websocket.BinaryMessage }
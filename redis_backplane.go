@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisChannelPrefix namespaces gostream's pub/sub traffic so it doesn't
+// collide with other users of the same Redis instance.
+const redisChannelPrefix = "gostream:room:"
+
+// RedisBackplane is a Backplane backed by Redis pub/sub.
+type RedisBackplane struct {
+	client *redis.Client
+
+	lock sync.Mutex
+	subs map[string]*redis.PubSub
+}
+
+// NewRedisBackplane creates a RedisBackplane that publishes and subscribes
+// through client.
+func NewRedisBackplane(client *redis.Client) *RedisBackplane {
+	return &RedisBackplane{
+		client: client,
+		subs:   make(map[string]*redis.PubSub),
+	}
+}
+
+func (b *RedisBackplane) channel(room string) string {
+	return redisChannelPrefix + room
+}
+
+// Publish sends msg to room's Redis channel.
+func (b *RedisBackplane) Publish(room string, msg []byte) error {
+	return b.client.Publish(context.Background(), b.channel(room), msg).Err()
+}
+
+// Subscribe subscribes to room's Redis channel and relays payloads onto the
+// returned channel until Unsubscribe is called for the same room.
+func (b *RedisBackplane) Subscribe(room string) (<-chan []byte, error) {
+	ps := b.client.Subscribe(context.Background(), b.channel(room))
+	if _, err := ps.Receive(context.Background()); err != nil {
+		ps.Close()
+		return nil, err
+	}
+
+	b.lock.Lock()
+	b.subs[room] = ps
+	b.lock.Unlock()
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for msg := range ps.Channel() {
+			out <- []byte(msg.Payload)
+		}
+	}()
+	return out, nil
+}
+
+// Unsubscribe stops relaying room's channel and closes the subscription.
+func (b *RedisBackplane) Unsubscribe(room string) {
+	b.lock.Lock()
+	ps, ok := b.subs[room]
+	delete(b.subs, room)
+	b.lock.Unlock()
+
+	if ok {
+		ps.Close()
+	}
+}
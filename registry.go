@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// RoomRegistry maps room names to their Hub, creating a Hub the first time a
+// room is used and letting it tear itself down once empty.
+type RoomRegistry struct {
+	lock sync.Mutex
+	hubs map[string]*Hub
+
+	cfg Config
+
+	// upgrader is built once from cfg so every connection shares the same
+	// WriteBufferPool instead of each allocating its own write buffer.
+	upgrader websocket.Upgrader
+
+	// instanceID identifies this process on cfg.Backplane, so a Hub can
+	// recognize and discard its own messages echoed back by the backplane.
+	instanceID string
+}
+
+// NewRoomRegistry creates an empty RoomRegistry configured by cfg.
+func NewRoomRegistry(cfg Config) *RoomRegistry {
+	return &RoomRegistry{
+		hubs:       make(map[string]*Hub),
+		cfg:        cfg,
+		upgrader:   buildUpgrader(cfg),
+		instanceID: newInstanceID(),
+	}
+}
+
+// newInstanceID returns a random identifier unique enough to tell this
+// process's backplane traffic apart from every other instance's.
+func newInstanceID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand failing would mean something is seriously wrong with
+		// the machine; an empty ID still lets self-messages dedupe against
+		// each other, it just collides with other instances that also
+		// failed here.
+		return ""
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// getOrCreateHub returns the Hub for room, starting its run loop with mode
+// the first time the room is seen. mode is ignored for rooms that already
+// have a Hub; the mode a room runs in is fixed by whichever client created
+// it.
+//
+// Returning a Hub here and a caller sending on its register channel are two
+// separate steps, so getOrCreateHub marks the Hub as having an incoming
+// registration pending (under the same lock removeHubIfEmpty uses) to rule
+// out a Hub deciding it's empty and tearing itself down in between: see
+// removeHubIfEmpty.
+func (r *RoomRegistry) getOrCreateHub(room string, mode RoutingMode) *Hub {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	h, ok := r.hubs[room]
+	if !ok {
+		h = newHub(room, mode, r)
+		r.hubs[room] = h
+		roomsTotal.Inc()
+		go h.run()
+	}
+	h.pending++
+	return h
+}
+
+// doneRegistering marks a pending registration on h as delivered. Called by
+// Hub.run once it has actually processed the corresponding register event.
+func (r *RoomRegistry) doneRegistering(h *Hub) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	h.pending--
+}
+
+// removeHubIfEmpty drops h from the registry if it has no clients and no
+// registration promised to it by getOrCreateHub is still in flight. It
+// reports whether h was removed. Called by h's own run loop, which must
+// return immediately afterwards if this returns true: once removed, a
+// concurrent getOrCreateHub call for the same room will build a fresh Hub
+// rather than hand out this one, so h is guaranteed nobody new will ever
+// send to its channels.
+func (r *RoomRegistry) removeHubIfEmpty(h *Hub) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if len(h.clients) != 0 || h.pending != 0 {
+		return false
+	}
+
+	delete(r.hubs, h.name)
+	roomsTotal.Dec()
+	clientsTotal.DeleteLabelValues(h.name)
+	return true
+}
+
+// snapshotHubs returns the Hubs currently registered, for use by the admin
+// API. The returned slice is a copy; the registry lock is not held while
+// querying each Hub for its RoomInfo.
+func (r *RoomRegistry) snapshotHubs() []*Hub {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	hubs := make([]*Hub, 0, len(r.hubs))
+	for _, h := range r.hubs {
+		hubs = append(hubs, h)
+	}
+	return hubs
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+)
+
+// RoutingMode selects how a published message is delivered to the clients
+// in a room.
+type RoutingMode int
+
+const (
+	// Broadcast delivers every message to all other clients in the room.
+	// This is the default and preserves the original chat-room behavior.
+	Broadcast RoutingMode = iota
+
+	// RoundRobin delivers each message to exactly one client, cycling
+	// through the room's clients in a stable order. Useful for turning a
+	// room into a work queue with one copy per message.
+	RoundRobin
+
+	// ConsistentHash delivers each message to exactly one client, chosen by
+	// hashing a caller-supplied routing key onto a hash ring, so the same
+	// key is handled by the same client for as long as it stays connected.
+	ConsistentHash
+)
+
+// String returns the query-param/admin-API spelling of m.
+func (m RoutingMode) String() string {
+	switch m {
+	case RoundRobin:
+		return "roundrobin"
+	case ConsistentHash:
+		return "consistenthash"
+	default:
+		return "broadcast"
+	}
+}
+
+// ParseRoutingMode parses the mode query param accepted by /ws. An empty
+// string means Broadcast.
+func ParseRoutingMode(s string) (RoutingMode, error) {
+	switch s {
+	case "", "broadcast":
+		return Broadcast, nil
+	case "roundrobin":
+		return RoundRobin, nil
+	case "consistenthash":
+		return ConsistentHash, nil
+	default:
+		return Broadcast, fmt.Errorf("unknown routing mode %q", s)
+	}
+}
+
+// routingKey returns the key used to pick a client in ConsistentHash mode.
+// key is the Envelope's own Key field, supplied by the publisher; if it's
+// empty, the raw message is used instead so routing is still deterministic,
+// just not meaningful to the caller (and not sticky across messages).
+func routingKey(key string, data []byte) string {
+	if key != "" {
+		return key
+	}
+	return string(data)
+}
+
+// virtualReplicas is the number of points each client gets on the hash ring.
+// A higher count spreads keys more evenly across clients.
+const virtualReplicas = 100
+
+// hashRing implements consistent hashing over a fixed set of clients so a
+// given routing key always lands on the same client, and only a fraction of
+// keys move when the client set changes.
+type hashRing struct {
+	points []uint32
+	owners map[uint32]*Client
+}
+
+// newHashRing builds a ring from clients. clients may be empty, in which
+// case get always returns nil.
+func newHashRing(clients map[*Client]bool) *hashRing {
+	r := &hashRing{owners: make(map[uint32]*Client, len(clients)*virtualReplicas)}
+	for c := range clients {
+		for i := 0; i < virtualReplicas; i++ {
+			h := hashString(fmt.Sprintf("%p-%d", c, i))
+			r.points = append(r.points, h)
+			r.owners[h] = c
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// get returns the client owning the first point on the ring at or after
+// hash(key), wrapping around to the first point if key hashes past the end.
+func (r *hashRing) get(key string) *Client {
+	if len(r.points) == 0 {
+		return nil
+	}
+	h := hashString(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+func hashString(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,80 @@
+package main
+
+import "testing"
+
+func TestParseRoutingMode(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    RoutingMode
+		wantErr bool
+	}{
+		{"", Broadcast, false},
+		{"broadcast", Broadcast, false},
+		{"roundrobin", RoundRobin, false},
+		{"consistenthash", ConsistentHash, false},
+		{"bogus", Broadcast, true},
+	}
+	for _, c := range cases {
+		got, err := ParseRoutingMode(c.in)
+		if (err != nil) != c.wantErr {
+			t.Errorf("ParseRoutingMode(%q) error = %v, wantErr %v", c.in, err, c.wantErr)
+		}
+		if got != c.want {
+			t.Errorf("ParseRoutingMode(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
+
+func TestRoutingModeStringRoundTrips(t *testing.T) {
+	for _, m := range []RoutingMode{Broadcast, RoundRobin, ConsistentHash} {
+		parsed, err := ParseRoutingMode(m.String())
+		if err != nil || parsed != m {
+			t.Errorf("ParseRoutingMode(%q) = %v, %v, want %v, nil", m.String(), parsed, err, m)
+		}
+	}
+}
+
+func TestRoutingKeyPrefersExplicitKey(t *testing.T) {
+	if got := routingKey("sticky", []byte("payload-a")); got != "sticky" {
+		t.Errorf("routingKey with an explicit key = %q, want %q", got, "sticky")
+	}
+	if got := routingKey("", []byte("payload-a")); got != "payload-a" {
+		t.Errorf("routingKey with no key should fall back to the raw data, got %q", got)
+	}
+}
+
+func TestHashRingStableForSameKey(t *testing.T) {
+	a, b, c := &Client{id: "a"}, &Client{id: "b"}, &Client{id: "c"}
+	ring := newHashRing(map[*Client]bool{a: true, b: true, c: true})
+
+	first := ring.get("order-42")
+	for i := 0; i < 100; i++ {
+		if got := ring.get("order-42"); got != first {
+			t.Fatalf("hash ring returned a different client for the same key on call %d: %p != %p", i, got, first)
+		}
+	}
+}
+
+func TestHashRingEmptyReturnsNil(t *testing.T) {
+	ring := newHashRing(nil)
+	if got := ring.get("anything"); got != nil {
+		t.Fatalf("empty hash ring should return nil, got %p", got)
+	}
+}
+
+func TestHashRingDistributesAcrossClients(t *testing.T) {
+	clients := map[*Client]bool{}
+	for i := 0; i < 5; i++ {
+		clients[&Client{id: nextClientID()}] = true
+	}
+	ring := newHashRing(clients)
+
+	hits := map[*Client]int{}
+	for i := 0; i < 500; i++ {
+		key := nextClientID()
+		hits[ring.get(key)]++
+	}
+	if len(hits) < 2 {
+		t.Fatalf("expected keys to spread across more than one client, got %d distinct owners", len(hits))
+	}
+}